@@ -0,0 +1,38 @@
+package link
+
+// Message is anything a Protocol can turn into a packet.
+type Message interface {
+	// RecommendBufferSize hints how large a buffer Packet should allocate
+	// before WriteBuffer is called.
+	RecommendBufferSize() int
+
+	// WriteBuffer appends the message's encoded bytes to buffer.Data.
+	WriteBuffer(buffer *Buffer) error
+}
+
+// Buffer is the scratch space a Protocol encodes into and decodes from. It
+// is reused across calls so protocols can avoid allocating on every
+// packet.
+type Buffer struct {
+	Data []byte
+
+	// head is how many bytes at the front of Data a Protocol reserved for
+	// a header it can't finalize until the message's final size is known
+	// (e.g. a varint length prefix whose width depends on that size).
+	// SetHead records the reservation; Head reports it back so the
+	// reserving Protocol can back-patch it once Data holds the full
+	// packet.
+	head int
+}
+
+// Head returns the number of bytes reserved at the front of Data by the
+// most recent call to SetHead.
+func (b *Buffer) Head() int {
+	return b.head
+}
+
+// SetHead records that the front n bytes of Data are reserved for a
+// header to be filled in later.
+func (b *Buffer) SetHead(n int) {
+	b.head = n
+}
@@ -0,0 +1,66 @@
+package link
+
+import "sync"
+
+// Size classes for the pooled buffers SimpleProtocol.Read grabs from,
+// similar to the chunked buffer pools used by BitTorrent peer protocol
+// decoders. Packets larger than maxPoolSizeClass aren't pooled, so a
+// single oversized packet can't permanently inflate a bucket.
+const (
+	minPoolSizeClass = 1 << 8  // 256 B
+	maxPoolSizeClass = 1 << 20 // 1 MiB
+)
+
+var sizeClassPools = make(map[int]*sync.Pool)
+
+func init() {
+	for size := minPoolSizeClass; size <= maxPoolSizeClass; size <<= 1 {
+		size := size
+		sizeClassPools[size] = &sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, size)
+				return &buf
+			},
+		}
+	}
+}
+
+// sizeClass returns the smallest pooled size class that can hold n bytes,
+// or 0 if n falls outside the pooled range.
+func sizeClass(n int) int {
+	if n <= 0 || n > maxPoolSizeClass {
+		return 0
+	}
+	size := minPoolSizeClass
+	for size < n {
+		size <<= 1
+	}
+	return size
+}
+
+// getPooled returns a byte slice of length n, reused from its size-class
+// pool when n falls within the pooled range.
+func getPooled(n int) []byte {
+	class := sizeClass(n)
+	if class == 0 {
+		return make([]byte, n)
+	}
+	buf := sizeClassPools[class].Get().(*[]byte)
+	return (*buf)[:n]
+}
+
+// Release returns the buffer's backing array to its size-class pool, if
+// its capacity exactly matches one, and invalidates Data. After Release,
+// Data and any alias of it must not be used.
+func (b *Buffer) Release() {
+	if b.Data == nil {
+		return
+	}
+
+	if class := sizeClass(cap(b.Data)); class != 0 && cap(b.Data) == class {
+		buf := b.Data[:cap(b.Data)]
+		sizeClassPools[class].Put(&buf)
+	}
+
+	b.Data = nil
+}
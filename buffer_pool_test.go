@@ -0,0 +1,70 @@
+package link
+
+import "testing"
+
+func TestSizeClassBoundaries(t *testing.T) {
+	cases := []struct {
+		n     int
+		class int
+	}{
+		{0, 0},
+		{1, minPoolSizeClass},
+		{minPoolSizeClass, minPoolSizeClass},
+		{minPoolSizeClass + 1, minPoolSizeClass * 2},
+		{maxPoolSizeClass, maxPoolSizeClass},
+		{maxPoolSizeClass + 1, 0},
+	}
+
+	for _, c := range cases {
+		if got := sizeClass(c.n); got != c.class {
+			t.Errorf("sizeClass(%d) = %d, want %d", c.n, got, c.class)
+		}
+	}
+}
+
+func TestGetPooledReturnsExactSizeClassCapacity(t *testing.T) {
+	buf := getPooled(minPoolSizeClass + 1)
+	if len(buf) != minPoolSizeClass+1 {
+		t.Fatalf("len = %d, want %d", len(buf), minPoolSizeClass+1)
+	}
+	if cap(buf) != minPoolSizeClass*2 {
+		t.Fatalf("cap = %d, want %d", cap(buf), minPoolSizeClass*2)
+	}
+}
+
+func TestGetPooledOversizedFallsBackToPlainAlloc(t *testing.T) {
+	n := maxPoolSizeClass + 1
+	buf := getPooled(n)
+	if len(buf) != n || cap(buf) != n {
+		t.Fatalf("expected an exact, unpooled allocation of %d, got len=%d cap=%d", n, len(buf), cap(buf))
+	}
+}
+
+func TestBufferReleaseOnlyPoolsExactSizeClassCaps(t *testing.T) {
+	// A slice whose cap doesn't land on a size-class boundary (e.g. grown
+	// by append) must not be handed back to a pool bucket.
+	odd := make([]byte, 10, minPoolSizeClass+17)
+	b := &Buffer{Data: odd}
+	b.Release()
+
+	if b.Data != nil {
+		t.Fatal("Release must always invalidate Data")
+	}
+
+	class := sizeClass(cap(odd))
+	if got := sizeClassPools[class].Get().(*[]byte); cap(*got) != class {
+		t.Fatalf("size class %d pool handed back a slice with cap %d", class, cap(*got))
+	}
+}
+
+func TestBufferReleaseReusesPooledSlice(t *testing.T) {
+	first := getPooled(minPoolSizeClass)
+	firstPtr := &first[0]
+
+	(&Buffer{Data: first}).Release()
+
+	second := getPooled(minPoolSizeClass)
+	if &second[0] != firstPtr {
+		t.Skip("pool did not reuse the released slice on this run")
+	}
+}
@@ -0,0 +1,279 @@
+package link
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// CompressionAlgorithm identifies how a packet's payload was compressed.
+// It is carried on the wire as a single byte ahead of the payload.
+type CompressionAlgorithm byte
+
+const (
+	CompressionNone   CompressionAlgorithm = 0
+	CompressionSnappy CompressionAlgorithm = 1
+	CompressionZstd   CompressionAlgorithm = 2
+	CompressionGzip   CompressionAlgorithm = 3
+)
+
+var (
+	// UnsupportedAlgorithmError happens when a packet names an algorithm
+	// for which no Compressor has been registered.
+	UnsupportedAlgorithmError = errors.New("link: unsupported compression algorithm")
+
+	// CompressionHeaderError happens when the algorithm tag or
+	// uncompressed-size varint can't be parsed.
+	CompressionHeaderError = errors.New("link: invalid compression header")
+
+	// DecompressedSizeError happens when the bytes actually produced by
+	// the decoder don't match the advertised uncompressed size.
+	DecompressedSizeError = errors.New("link: decompressed size mismatch")
+)
+
+// Compressor implements one compression algorithm pluggable into
+// CompressedProtocol. Gzip is registered by default since it's in the
+// standard library; register a Compressor backed by klauspost/compress
+// (zstd) or golang/snappy to use those.
+type Compressor interface {
+	Algorithm() CompressionAlgorithm
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+var compressors = map[CompressionAlgorithm]Compressor{}
+
+// RegisterCompressor makes a Compressor available to every
+// CompressedProtocol by its Algorithm tag.
+func RegisterCompressor(compressor Compressor) {
+	compressors[compressor.Algorithm()] = compressor
+}
+
+func init() {
+	RegisterCompressor(gzipCompressor{})
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Algorithm() CompressionAlgorithm { return CompressionGzip }
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// compressionStrength orders algorithms from strongest (best ratio) to
+// weakest, for NegotiateCompression.
+var compressionStrength = []CompressionAlgorithm{
+	CompressionZstd,
+	CompressionGzip,
+	CompressionSnappy,
+}
+
+// NegotiateCompression picks the strongest algorithm both peers support,
+// given the algorithm lists they exchanged at handshake time, falling back
+// to CompressionNone when nothing matches.
+func NegotiateCompression(local, remote []CompressionAlgorithm) CompressionAlgorithm {
+	for _, algo := range compressionStrength {
+		if containsAlgorithm(local, algo) && containsAlgorithm(remote, algo) {
+			return algo
+		}
+	}
+	return CompressionNone
+}
+
+func containsAlgorithm(algos []CompressionAlgorithm, algo CompressionAlgorithm) bool {
+	for _, a := range algos {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+var compressBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// CompressedProtocol decorates any Protocol with per-packet compression.
+// The payload is prefixed with a one-byte algorithm tag and a varint
+// uncompressed size so the receiver can pre-size its buffer and enforce
+// MaxPacketSize on the decompressed length rather than the wire length.
+type CompressedProtocol struct {
+	// Protocol frames the compressed payload.
+	Protocol Protocol
+
+	// Algorithm is used to compress outgoing packets. CompressionNone
+	// disables compression without removing the header.
+	Algorithm CompressionAlgorithm
+
+	// MaxPacketSize bounds the decompressed payload size.
+	MaxPacketSize int
+}
+
+// Compressed wraps protocol with per-packet compression using algorithm.
+func Compressed(protocol Protocol, algorithm CompressionAlgorithm) *CompressedProtocol {
+	return &CompressedProtocol{Protocol: protocol, Algorithm: algorithm}
+}
+
+// Write a packet. The buffer maybe grows.
+func (p *CompressedProtocol) Packet(buffer *Buffer, message Message) error {
+	var raw Buffer
+	if err := message.WriteBuffer(&raw); err != nil {
+		return err
+	}
+
+	algo := p.Algorithm
+	compressed, err := p.compress(algo, raw.Data)
+	if err != nil {
+		return err
+	}
+
+	// Compression didn't pay for itself; ship the raw bytes instead.
+	if algo != CompressionNone && len(compressed) >= len(raw.Data) {
+		algo = CompressionNone
+		compressed = raw.Data
+	}
+
+	var head [1 + binary.MaxVarintLen64]byte
+	head[0] = byte(algo)
+	n := binary.PutUvarint(head[1:], uint64(len(raw.Data)))
+
+	buffer.Data = buffer.Data[:0]
+	buffer.Data = append(buffer.Data, head[:1+n]...)
+	buffer.Data = append(buffer.Data, compressed...)
+
+	return nil
+}
+
+// Write a packet. The buffer maybe grows.
+func (p *CompressedProtocol) Write(writer io.Writer, buffer *Buffer) error {
+	var frame Buffer
+	if err := p.Protocol.Packet(&frame, rawMessage(buffer.Data)); err != nil {
+		return err
+	}
+	return p.Protocol.Write(writer, &frame)
+}
+
+// Read a packet. The buffer maybe grows.
+//
+// The advertised uncompressed size is never trusted for pre-allocation: a
+// peer could claim an arbitrarily large size in a tiny compressed frame to
+// force a huge eager allocation before a single byte is decompressed. That
+// defense holds even when MaxPacketSize is left at its zero-value
+// "unbounded" setting, matching the rest of this package's convention,
+// because the decoder is never asked to produce more than the advertised
+// size regardless - memory only ever grows with bytes the peer actually
+// made the decoder emit.
+func (p *CompressedProtocol) Read(reader io.Reader, buffer *Buffer) error {
+	var frame Buffer
+	if err := p.Protocol.Read(reader, &frame); err != nil {
+		return err
+	}
+	defer frame.Release()
+
+	if len(frame.Data) == 0 {
+		return CompressionHeaderError
+	}
+
+	algo := CompressionAlgorithm(frame.Data[0])
+	size, n := binary.Uvarint(frame.Data[1:])
+	if n <= 0 {
+		return CompressionHeaderError
+	}
+	payload := frame.Data[1+n:]
+
+	if p.MaxPacketSize > 0 && size > uint64(p.MaxPacketSize) {
+		return PacketTooLargeError
+	}
+
+	if algo == CompressionNone {
+		if uint64(len(payload)) != size {
+			return DecompressedSizeError
+		}
+		if cap(buffer.Data) < int(size) {
+			buffer.Data = getPooled(int(size))
+		} else {
+			buffer.Data = buffer.Data[:size]
+		}
+		copy(buffer.Data, payload)
+		return nil
+	}
+
+	compressor, ok := compressors[algo]
+	if !ok {
+		return UnsupportedAlgorithmError
+	}
+
+	decoder, err := compressor.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	out := compressBufferPool.Get().(*bytes.Buffer)
+	out.Reset()
+	defer compressBufferPool.Put(out)
+
+	// io.LimitReader caps the decoder output actually requested at the
+	// advertised size, so out only ever grows with bytes the peer really
+	// produced - not with a forged size field.
+	written, err := io.Copy(out, io.LimitReader(decoder, int64(size)))
+	if err != nil {
+		return err
+	}
+	if uint64(written) != size {
+		return DecompressedSizeError
+	}
+
+	// Confirm the decoder doesn't still have more data waiting beyond the
+	// advertised size, which would mean it understated the real output.
+	var extra [1]byte
+	if m, _ := decoder.Read(extra[:]); m > 0 {
+		return DecompressedSizeError
+	}
+
+	if cap(buffer.Data) < out.Len() {
+		buffer.Data = getPooled(out.Len())
+	} else {
+		buffer.Data = buffer.Data[:out.Len()]
+	}
+	copy(buffer.Data, out.Bytes())
+
+	return nil
+}
+
+func (p *CompressedProtocol) compress(algo CompressionAlgorithm, data []byte) ([]byte, error) {
+	if algo == CompressionNone {
+		return data, nil
+	}
+
+	compressor, ok := compressors[algo]
+	if !ok {
+		return nil, UnsupportedAlgorithmError
+	}
+
+	buf := compressBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer compressBufferPool.Put(buf)
+
+	w, err := compressor.NewWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, buf.Len())
+	copy(out, buf.Bytes())
+	return out, nil
+}
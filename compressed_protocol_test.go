@@ -0,0 +1,136 @@
+package link
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCompressedProtocolRoundtrip(t *testing.T) {
+	proto := Compressed(PacketN(4, BigEndian), CompressionGzip)
+
+	payload := bytes.Repeat([]byte("compress me please "), 50)
+
+	var buf Buffer
+	if err := proto.Packet(&buf, rawMessage(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out.Data, payload) {
+		t.Fatalf("mismatch: got %d bytes, want %d", len(out.Data), len(payload))
+	}
+}
+
+func TestCompressedProtocolNoneFallsBackWhenNotSmaller(t *testing.T) {
+	proto := Compressed(PacketN(4, BigEndian), CompressionGzip)
+
+	// Too short for gzip to ever shrink; Packet should fall back to
+	// CompressionNone on the wire.
+	payload := []byte("x")
+
+	var buf Buffer
+	if err := proto.Packet(&buf, rawMessage(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	if CompressionAlgorithm(buf.Data[0]) != CompressionNone {
+		t.Fatalf("expected fallback to CompressionNone, got tag %d", buf.Data[0])
+	}
+
+	var wire bytes.Buffer
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Data, payload) {
+		t.Fatalf("got %q, want %q", out.Data, payload)
+	}
+}
+
+func TestCompressedProtocolCorruptHeader(t *testing.T) {
+	underlying := PacketN(4, BigEndian)
+	proto := Compressed(underlying, CompressionGzip)
+
+	frame := Buffer{Data: make([]byte, 0, 4)}
+	if err := underlying.Packet(&frame, rawMessage(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := underlying.Write(&wire, &frame); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != CompressionHeaderError {
+		t.Fatalf("expected CompressionHeaderError, got %v", err)
+	}
+}
+
+func TestCompressedProtocolRejectsForgedUncompressedSize(t *testing.T) {
+	underlying := PacketN(4, BigEndian)
+	proto := Compressed(underlying, CompressionGzip)
+	// Left at its zero value on purpose: the forged-size defense must
+	// hold even when MaxPacketSize is unset, matching this package's
+	// "zero means unbounded" convention.
+	proto.MaxPacketSize = 0
+
+	compressed, err := proto.compress(CompressionGzip, []byte("tiny"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var head [1 + binary.MaxVarintLen64]byte
+	head[0] = byte(CompressionGzip)
+	n := binary.PutUvarint(head[1:], 1<<40) // forged: claims a 1 TiB payload
+
+	var payload Buffer
+	payload.Data = append(payload.Data, head[:1+n]...)
+	payload.Data = append(payload.Data, compressed...)
+
+	var frame Buffer
+	if err := underlying.Packet(&frame, rawMessage(payload.Data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := underlying.Write(&wire, &frame); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != DecompressedSizeError {
+		t.Fatalf("expected DecompressedSizeError, got %v", err)
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	cases := []struct {
+		local, remote []CompressionAlgorithm
+		want          CompressionAlgorithm
+	}{
+		{[]CompressionAlgorithm{CompressionZstd, CompressionGzip}, []CompressionAlgorithm{CompressionGzip}, CompressionGzip},
+		{[]CompressionAlgorithm{CompressionZstd, CompressionGzip}, []CompressionAlgorithm{CompressionZstd}, CompressionZstd},
+		{[]CompressionAlgorithm{CompressionGzip}, []CompressionAlgorithm{CompressionSnappy}, CompressionNone},
+	}
+
+	for _, c := range cases {
+		if got := NegotiateCompression(c.local, c.remote); got != c.want {
+			t.Errorf("NegotiateCompression(%v, %v) = %v, want %v", c.local, c.remote, got, c.want)
+		}
+	}
+}
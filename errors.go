@@ -0,0 +1,7 @@
+package link
+
+import "errors"
+
+// PacketTooLargeError happens when a packet, either decoded off the wire
+// or about to be written, exceeds a Protocol's MaxPacketSize.
+var PacketTooLargeError = errors.New("link: packet too large")
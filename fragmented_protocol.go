@@ -0,0 +1,213 @@
+package link
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// FragmentOrderError happens when a continuation frame arrives before
+	// any data frame opened a message, or a data frame arrives while a
+	// fragmented message is already in progress.
+	FragmentOrderError = errors.New("link: out-of-order fragment")
+
+	// InterleavedControlFrameError happens when a ping/pong frame shows up
+	// in the middle of a fragmented message instead of between messages.
+	InterleavedControlFrameError = errors.New("link: control frame interleaved with fragmented message")
+
+	// FrameHeaderError happens when a frame is missing its control byte or
+	// carries an unknown opcode.
+	FrameHeaderError = errors.New("link: invalid fragment header")
+
+	// MessageTooLargeError happens when the reassembled message would
+	// exceed FragmentedProtocol.MaxMessageSize.
+	MessageTooLargeError = errors.New("link: message too large")
+
+	// ConnectionClosedError happens when the peer sends a close frame.
+	ConnectionClosedError = errors.New("link: peer sent close frame")
+)
+
+// Fragment opcodes, WebSocket-style: bit 7 of the header byte is the FIN
+// flag, bits 0-6 are the opcode.
+const (
+	fragFin = 0x80
+
+	opContinuation byte = 0
+	opData         byte = 1
+	opPing         byte = 2
+	opPong         byte = 3
+	opClose        byte = 8
+)
+
+// rawMessage lets FragmentedProtocol hand already-framed bytes to an
+// underlying Protocol's Packet method.
+type rawMessage []byte
+
+func (m rawMessage) RecommendBufferSize() int {
+	return len(m)
+}
+
+func (m rawMessage) WriteBuffer(buffer *Buffer) error {
+	buffer.Data = append(buffer.Data, m...)
+	return nil
+}
+
+// FragmentedProtocol wraps an underlying Protocol and splits oversized
+// messages into a sequence of frames, each carrying a 1-byte continuation
+// header, and reassembles them on Read. This lets Protocol keep a small
+// MaxPacketSize (bounding memory per frame) while still supporting
+// arbitrarily large application messages, the same trade WebSocket and
+// several peer protocols make.
+type FragmentedProtocol struct {
+	// Protocol frames the individual fragments. Its MaxPacketSize, if any,
+	// bounds the size of one fragment, not the reassembled message.
+	Protocol Protocol
+
+	// FragmentSize is the maximum payload carried by one frame. Messages
+	// no larger than this are sent as a single FIN frame.
+	FragmentSize int
+
+	// MaxMessageSize bounds the reassembled message across all fragments.
+	// Zero means unbounded.
+	MaxMessageSize int
+
+	// OnPing and OnPong, if set, are called when a ping/pong frame is
+	// read, instead of surfacing it as message data.
+	OnPing func()
+	OnPong func()
+}
+
+// Fragmented wraps protocol with message fragmentation.
+func Fragmented(protocol Protocol, fragmentSize int) *FragmentedProtocol {
+	return &FragmentedProtocol{
+		Protocol:     protocol,
+		FragmentSize: fragmentSize,
+	}
+}
+
+// Write a packet. The buffer maybe grows.
+func (p *FragmentedProtocol) Packet(buffer *Buffer, message Message) error {
+	buffer.Data = buffer.Data[:0]
+	return message.WriteBuffer(buffer)
+}
+
+// Write a packet. The buffer maybe grows. The message is split into one or
+// more frames of at most FragmentSize bytes.
+func (p *FragmentedProtocol) Write(writer io.Writer, buffer *Buffer) error {
+	data := buffer.Data
+
+	fragmentSize := p.FragmentSize
+	if fragmentSize <= 0 {
+		fragmentSize = len(data)
+	}
+
+	if len(data) == 0 {
+		return p.writeFrame(writer, fragFin|opData, nil)
+	}
+
+	op := opData
+	for len(data) > 0 {
+		n := fragmentSize
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		chunk := data[:n]
+		data = data[n:]
+
+		head := op
+		if len(data) == 0 {
+			head |= fragFin
+		}
+
+		if err := p.writeFrame(writer, head, chunk); err != nil {
+			return err
+		}
+
+		op = opContinuation
+	}
+
+	return nil
+}
+
+func (p *FragmentedProtocol) writeFrame(writer io.Writer, head byte, payload []byte) error {
+	msg := make(rawMessage, 0, 1+len(payload))
+	msg = append(msg, head)
+	msg = append(msg, payload...)
+
+	var frame Buffer
+	if err := p.Protocol.Packet(&frame, msg); err != nil {
+		return err
+	}
+	return p.Protocol.Write(writer, &frame)
+}
+
+// Read a packet. The buffer maybe grows. Fragments are reassembled until a
+// FIN frame is seen. Ping/pong frames arriving between messages are
+// dispatched to OnPing/OnPong; one arriving in the middle of a fragmented
+// message fails the read with InterleavedControlFrameError.
+func (p *FragmentedProtocol) Read(reader io.Reader, buffer *Buffer) error {
+	buffer.Data = buffer.Data[:0]
+	inProgress := false
+
+	for {
+		var frame Buffer
+		if err := p.Protocol.Read(reader, &frame); err != nil {
+			return err
+		}
+
+		if len(frame.Data) == 0 {
+			frame.Release()
+			return FrameHeaderError
+		}
+
+		head := frame.Data[0]
+		fin := head&fragFin != 0
+		op := head &^ fragFin
+		payload := frame.Data[1:]
+
+		switch op {
+		case opPing:
+			if inProgress {
+				return InterleavedControlFrameError
+			}
+			if p.OnPing != nil {
+				p.OnPing()
+			}
+			frame.Release()
+			continue
+		case opPong:
+			if inProgress {
+				return InterleavedControlFrameError
+			}
+			if p.OnPong != nil {
+				p.OnPong()
+			}
+			frame.Release()
+			continue
+		case opClose:
+			return ConnectionClosedError
+		case opData:
+			if inProgress {
+				return FragmentOrderError
+			}
+		case opContinuation:
+			if !inProgress {
+				return FragmentOrderError
+			}
+		default:
+			return FrameHeaderError
+		}
+
+		inProgress = true
+		buffer.Data = append(buffer.Data, payload...)
+		frame.Release()
+
+		if p.MaxMessageSize > 0 && len(buffer.Data) > p.MaxMessageSize {
+			return MessageTooLargeError
+		}
+
+		if fin {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package link
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFragmentedProtocolRoundtrip(t *testing.T) {
+	proto := Fragmented(PacketN(2, BigEndian), 4)
+
+	var buf Buffer
+	message := rawMessage("hello fragmented world")
+	if err := proto.Packet(&buf, message); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out.Data) != string(message) {
+		t.Fatalf("got %q, want %q", out.Data, message)
+	}
+}
+
+func TestFragmentedProtocolPingPongDoNotCorruptStream(t *testing.T) {
+	underlying := PacketN(2, BigEndian)
+	proto := Fragmented(underlying, 100)
+
+	var pinged bool
+	proto.OnPing = func() { pinged = true }
+
+	var wire bytes.Buffer
+
+	var ping Buffer
+	if err := underlying.Packet(&ping, rawMessage([]byte{fragFin | opPing})); err != nil {
+		t.Fatal(err)
+	}
+	if err := underlying.Write(&wire, &ping); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf Buffer
+	if err := proto.Packet(&buf, rawMessage("data after ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pinged {
+		t.Fatal("expected OnPing to be called")
+	}
+	if string(out.Data) != "data after ping" {
+		t.Fatalf("got %q", out.Data)
+	}
+}
+
+func TestFragmentedProtocolMaxMessageSize(t *testing.T) {
+	proto := Fragmented(PacketN(2, BigEndian), 4)
+	proto.MaxMessageSize = 8
+
+	var buf Buffer
+	if err := proto.Packet(&buf, rawMessage("this message is too long")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != MessageTooLargeError {
+		t.Fatalf("expected MessageTooLargeError, got %v", err)
+	}
+}
+
+func TestFragmentedProtocolOutOfOrderContinuation(t *testing.T) {
+	underlying := PacketN(2, BigEndian)
+	proto := Fragmented(underlying, 100)
+
+	var wire bytes.Buffer
+	var frame Buffer
+	if err := underlying.Packet(&frame, rawMessage([]byte{fragFin | opContinuation, 'x'})); err != nil {
+		t.Fatal(err)
+	}
+	if err := underlying.Write(&wire, &frame); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != FragmentOrderError {
+		t.Fatalf("expected FragmentOrderError, got %v", err)
+	}
+}
+
+func TestFragmentedProtocolInterleavedControlFrame(t *testing.T) {
+	underlying := PacketN(2, BigEndian)
+	proto := Fragmented(underlying, 100)
+
+	var wire bytes.Buffer
+
+	var first Buffer
+	if err := underlying.Packet(&first, rawMessage([]byte{opData, 'a'})); err != nil {
+		t.Fatal(err)
+	}
+	if err := underlying.Write(&wire, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	var control Buffer
+	if err := underlying.Packet(&control, rawMessage([]byte{fragFin | opPing})); err != nil {
+		t.Fatal(err)
+	}
+	if err := underlying.Write(&wire, &control); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != InterleavedControlFrameError {
+		t.Fatalf("expected InterleavedControlFrameError, got %v", err)
+	}
+}
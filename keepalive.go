@@ -0,0 +1,109 @@
+package link
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// KeepaliveFrameError happens when Keepalive is enabled and a packet
+	// doesn't carry a recognized opcode byte.
+	KeepaliveFrameError = errors.New("link: invalid keepalive frame")
+
+	// KeepaliveNotEnabledError happens when WritePing/WritePong is called
+	// on a protocol that didn't opt into Keepalive.
+	KeepaliveNotEnabledError = errors.New("link: keepalive not enabled")
+)
+
+// KeepaliveProtocol is implemented by protocols that can frame their own
+// ping/pong control packets inline with the data stream, so applications
+// don't need to build an out-of-band heartbeat for every message type.
+// SimpleProtocol implements it when Keepalive is set to true.
+type KeepaliveProtocol interface {
+	Protocol
+
+	// WritePing writes a ping control packet carrying no application data.
+	WritePing(writer io.Writer) error
+
+	// WritePong writes a pong control packet carrying no application data.
+	WritePong(writer io.Writer) error
+}
+
+// Keepalive runs a ping/pong heartbeat over a connection, modeled on the
+// idle-timeout/ping-timeout pattern in Tendermint's MConnection: it sends
+// a ping every PingInterval and closes the connection if no matching pong
+// arrives within PongTimeout.
+//
+// Wire a protocol's OnPong callback to call Pong, then run Run in its own
+// goroutine for the lifetime of the connection.
+type Keepalive struct {
+	Protocol     KeepaliveProtocol
+	Writer       io.Writer
+	Closer       io.Closer
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	pong chan struct{}
+}
+
+// NewKeepalive creates a Keepalive that pings over writer using protocol,
+// and closes closer if a pong doesn't arrive within pongTimeout.
+func NewKeepalive(protocol KeepaliveProtocol, writer io.Writer, closer io.Closer, pingInterval, pongTimeout time.Duration) *Keepalive {
+	return &Keepalive{
+		Protocol:     protocol,
+		Writer:       writer,
+		Closer:       closer,
+		PingInterval: pingInterval,
+		PongTimeout:  pongTimeout,
+		pong:         make(chan struct{}, 1),
+	}
+}
+
+// Pong notifies the keepalive loop that a pong was received. Call this
+// from the protocol's OnPong callback.
+func (k *Keepalive) Pong() {
+	select {
+	case k.pong <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends a ping every PingInterval and closes the connection if no pong
+// arrives within PongTimeout or a ping can't be written. It returns when
+// stop is closed or right after it closes the connection.
+func (k *Keepalive) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(k.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			// Drop any pong left over from before this ping -- a stray,
+			// duplicate, or late arrival can't be answering a ping we
+			// haven't sent yet, and leaving it buffered would let it be
+			// wrongly claimed by the wait below.
+			select {
+			case <-k.pong:
+			default:
+			}
+
+			if err := k.Protocol.WritePing(k.Writer); err != nil {
+				k.Closer.Close()
+				return
+			}
+
+			select {
+			case <-k.pong:
+			case <-time.After(k.PongTimeout):
+				k.Closer.Close()
+				return
+			case <-stop:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package link
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimpleProtocolKeepaliveRoundtrip(t *testing.T) {
+	proto := PacketN(2, BigEndian)
+	proto.Keepalive = true
+
+	var pinged, ponged bool
+	proto.OnPing = func() { pinged = true }
+	proto.OnPong = func() { ponged = true }
+
+	var wire bytes.Buffer
+	if err := proto.WritePing(&wire); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.WritePong(&wire); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf Buffer
+	if err := proto.Packet(&buf, rawMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Write(&wire, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Buffer
+	if err := proto.Read(&wire, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pinged || !ponged {
+		t.Fatalf("pinged=%v ponged=%v, want both true", pinged, ponged)
+	}
+	if string(out.Data) != "hello" {
+		t.Fatalf("got %q, want %q", out.Data, "hello")
+	}
+}
+
+func TestSimpleProtocolKeepaliveZeroLengthIsMalformed(t *testing.T) {
+	proto := PacketN(2, BigEndian)
+	proto.Keepalive = true
+
+	wire := bytes.NewBuffer([]byte{0, 0})
+
+	var out Buffer
+	if err := proto.Read(wire, &out); err != KeepaliveFrameError {
+		t.Fatalf("expected KeepaliveFrameError, got %v", err)
+	}
+}
+
+// fakeKeepaliveProtocol counts pings and can be made to fail WritePing.
+type fakeKeepaliveProtocol struct {
+	Protocol
+	pings   int
+	failing bool
+}
+
+func (f *fakeKeepaliveProtocol) WritePing(writer io.Writer) error {
+	f.pings++
+	if f.failing {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func (f *fakeKeepaliveProtocol) WritePong(writer io.Writer) error {
+	return nil
+}
+
+type fakeCloser struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (f *fakeCloser) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeCloser) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func TestKeepaliveClosesOnMissingPong(t *testing.T) {
+	k := NewKeepalive(&fakeKeepaliveProtocol{}, &bytes.Buffer{}, &fakeCloser{}, 5*time.Millisecond, 5*time.Millisecond)
+	closer := k.Closer.(*fakeCloser)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go k.Run(stop)
+
+	time.Sleep(50 * time.Millisecond)
+
+	if !closer.isClosed() {
+		t.Fatal("expected Keepalive to close the connection after a missing pong")
+	}
+}
+
+func TestKeepaliveStalePongDoesNotCountTowardNextPing(t *testing.T) {
+	proto := &fakeKeepaliveProtocol{}
+	closer := &fakeCloser{}
+	k := NewKeepalive(proto, &bytes.Buffer{}, closer, 20*time.Millisecond, 15*time.Millisecond)
+
+	// A stray pong arrives before any ping has even been sent -- it must
+	// be drained in front of the first ping rather than wrongly satisfying
+	// that ping's wait, so with no real pong ever following, the
+	// connection should still be closed for a missing pong.
+	k.Pong()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go k.Run(stop)
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !closer.isClosed() {
+		t.Fatal("a stale pong must not be credited to the next ping's wait")
+	}
+}
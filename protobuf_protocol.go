@@ -0,0 +1,175 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// VarintTooLongError happens when a varint length prefix doesn't terminate
+// within the 10 bytes needed to hold a 64-bit value.
+var VarintTooLongError = errors.New("link: varint too long")
+
+// ProtoMessage is implemented by generated protobuf types, including both
+// google.golang.org/protobuf and gogo/protobuf messages, which already
+// provide Marshal/Unmarshal with this exact signature.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// protoMessage adapts a ProtoMessage to the Message interface so it can be
+// passed to Protocol.Packet.
+type protoMessage struct {
+	ProtoMessage
+}
+
+// Proto wraps a ProtoMessage so it can be packeted with ProtobufProtocol
+// (or any other Protocol).
+func Proto(message ProtoMessage) Message {
+	return protoMessage{message}
+}
+
+func (p protoMessage) RecommendBufferSize() int {
+	return 64
+}
+
+func (p protoMessage) WriteBuffer(buffer *Buffer) error {
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	buffer.Data = append(buffer.Data, data...)
+	return nil
+}
+
+// The packet spliting protocol using protobuf's varint length-delimited
+// encoding, the same framing used by gogoproto's delimited reader/writer.
+// Unlike SimpleProtocol, the header width grows with the message size
+// instead of being fixed, so small messages don't pay for a header sized
+// for the largest possible packet.
+type ProtobufProtocol struct {
+	MaxPacketSize int
+}
+
+// Create a varint length-delimited protobuf protocol.
+func Protobuf() *ProtobufProtocol {
+	return &ProtobufProtocol{}
+}
+
+// Write a packet. The buffer maybe grows. The header is reserved up front
+// from message.RecommendBufferSize(), the same way SimpleProtocol.Packet
+// reserves its fixed p.n header bytes, and Write back-patches it once the
+// final size is known -- avoiding a payload-sized copy on every packet.
+func (p *ProtobufProtocol) Packet(buffer *Buffer, message Message) error {
+	estimate := message.RecommendBufferSize()
+	head := uvarintSize(uint64(estimate))
+
+	if cap(buffer.Data) < head {
+		buffer.Data = make([]byte, head, head+estimate)
+	} else {
+		buffer.Data = buffer.Data[:head]
+	}
+	buffer.SetHead(head)
+
+	return message.WriteBuffer(buffer)
+}
+
+// Write a packet. The buffer maybe grows.
+func (p *ProtobufProtocol) Write(writer io.Writer, buffer *Buffer) error {
+	head := buffer.Head()
+	size := len(buffer.Data) - head
+
+	// The reserved header was sized off RecommendBufferSize's estimate;
+	// back-patch it now that the final size is known. Only a message
+	// landing on the other side of a varint width boundary from its own
+	// estimate needs the payload shifted, which is rare in practice.
+	if actualHead := uvarintSize(uint64(size)); actualHead != head {
+		if actualHead > head {
+			buffer.Data = append(buffer.Data, make([]byte, actualHead-head)...)
+		}
+		copy(buffer.Data[actualHead:actualHead+size], buffer.Data[head:head+size])
+		buffer.Data = buffer.Data[:actualHead+size]
+		head = actualHead
+	}
+
+	if p.MaxPacketSize > 0 && len(buffer.Data) > p.MaxPacketSize {
+		return PacketTooLargeError
+	}
+
+	binary.PutUvarint(buffer.Data[:head], uint64(size))
+
+	if _, err := writer.Write(buffer.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Read a packet. The buffer maybe grows.
+func (p *ProtobufProtocol) Read(reader io.Reader, buffer *Buffer) error {
+	size, err := readUvarint(reader, p.MaxPacketSize)
+	if err != nil {
+		return err
+	}
+
+	if p.MaxPacketSize > 0 && size > uint64(p.MaxPacketSize) {
+		return PacketTooLargeError
+	}
+
+	if cap(buffer.Data) < int(size) {
+		buffer.Data = make([]byte, size)
+	} else {
+		buffer.Data = buffer.Data[0:size]
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	if _, err := io.ReadFull(reader, buffer.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// uvarintSize returns the number of bytes binary.PutUvarint would use to
+// encode x.
+func uvarintSize(x uint64) int {
+	if x == 0 {
+		return 1
+	}
+	return 1 + (bits.Len64(x)-1)/7
+}
+
+// readUvarint decodes a varint from reader one byte at a time, bailing out
+// early once the accumulated value would exceed maxPacketSize so a peer
+// can't force us to read up to the full 10 bytes on every oversized packet.
+func readUvarint(reader io.Reader, maxPacketSize int) (uint64, error) {
+	var head [1]byte
+	var x uint64
+	var s uint
+
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		if _, err := io.ReadFull(reader, head[:]); err != nil {
+			return 0, err
+		}
+
+		b := head[0]
+		if b < 0x80 {
+			x |= uint64(b) << s
+			return x, nil
+		}
+
+		x |= uint64(b&0x7f) << s
+		s += 7
+
+		if maxPacketSize > 0 && x > uint64(maxPacketSize) {
+			return 0, PacketTooLargeError
+		}
+	}
+
+	return 0, VarintTooLongError
+}
@@ -0,0 +1,109 @@
+package link
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type testMessage struct {
+	data      []byte
+	recommend int
+}
+
+func (m testMessage) RecommendBufferSize() int {
+	return m.recommend
+}
+
+func (m testMessage) WriteBuffer(buffer *Buffer) error {
+	buffer.Data = append(buffer.Data, m.data...)
+	return nil
+}
+
+func TestProtobufProtocolRoundtrip(t *testing.T) {
+	sizes := []int{0, 1, 126, 127, 128, 129, 16383, 16384, 16385}
+
+	for _, n := range sizes {
+		data := bytes.Repeat([]byte{0xAB}, n)
+
+		// A deliberately wrong RecommendBufferSize forces Write to hit
+		// the varint-width back-patch path at some of these boundaries.
+		msg := testMessage{data: data, recommend: 10}
+
+		proto := Protobuf()
+
+		var buf Buffer
+		if err := proto.Packet(&buf, msg); err != nil {
+			t.Fatalf("n=%d: Packet: %v", n, err)
+		}
+
+		var wire bytes.Buffer
+		if err := proto.Write(&wire, &buf); err != nil {
+			t.Fatalf("n=%d: Write: %v", n, err)
+		}
+
+		var out Buffer
+		if err := proto.Read(&wire, &out); err != nil {
+			t.Fatalf("n=%d: Read: %v", n, err)
+		}
+
+		if !bytes.Equal(out.Data, data) {
+			t.Fatalf("n=%d: got %d bytes, want %d", n, len(out.Data), len(data))
+		}
+	}
+}
+
+func TestProtobufProtocolMaxPacketSize(t *testing.T) {
+	proto := Protobuf()
+	proto.MaxPacketSize = 4
+
+	var buf Buffer
+	msg := testMessage{data: []byte("too long"), recommend: 8}
+	if err := proto.Packet(&buf, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := proto.Write(&wire, &buf); err != PacketTooLargeError {
+		t.Fatalf("expected PacketTooLargeError, got %v", err)
+	}
+}
+
+func TestProtobufProtocolTruncatedVarint(t *testing.T) {
+	proto := Protobuf()
+
+	// A continuation byte with nothing following it.
+	wire := bytes.NewBuffer([]byte{0x80})
+
+	var out Buffer
+	if err := proto.Read(wire, &out); err == nil {
+		t.Fatal("expected an error reading a truncated varint")
+	}
+}
+
+func TestProtobufProtocolOverlongVarint(t *testing.T) {
+	proto := Protobuf()
+
+	// 10 bytes, all with the continuation bit set: never terminates.
+	wire := bytes.NewBuffer(bytes.Repeat([]byte{0x80}, 10))
+
+	var out Buffer
+	if err := proto.Read(wire, &out); err != VarintTooLongError {
+		t.Fatalf("expected VarintTooLongError, got %v", err)
+	}
+}
+
+func TestProtobufProtocolReadRejectsOversizedAdvertisedSize(t *testing.T) {
+	proto := Protobuf()
+	proto.MaxPacketSize = 4
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, 1<<20) // far beyond MaxPacketSize
+
+	wire := bytes.NewBuffer(buf[:n])
+
+	var out Buffer
+	if err := proto.Read(wire, &out); err != PacketTooLargeError {
+		t.Fatalf("expected PacketTooLargeError, got %v", err)
+	}
+}
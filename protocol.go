@@ -32,8 +32,24 @@ type SimpleProtocol struct {
 	encodeHead    func([]byte)
 	decodeHead    func() int
 	MaxPacketSize int
+
+	// Keepalive opts into an inline ping/pong control channel, framed as
+	// an extra opcode byte ahead of the payload. It must be set the same
+	// way on both peers. See KeepaliveProtocol.
+	Keepalive bool
+
+	// OnPing and OnPong, set when Keepalive is true, are called by Read
+	// when a control packet arrives, instead of returning it as data.
+	OnPing func()
+	OnPong func()
 }
 
+const (
+	keepaliveData byte = 0
+	keepalivePing byte = 1
+	keepalivePong byte = 2
+)
+
 // Create a {packet, N} protocol.
 // The n means how many bytes of the packet header.
 func PacketN(n int, byteOrder binary.ByteOrder) *SimpleProtocol {
@@ -81,12 +97,22 @@ func PacketN(n int, byteOrder binary.ByteOrder) *SimpleProtocol {
 
 // Write a packet. The buffer maybe grows.
 func (p *SimpleProtocol) Packet(buffer *Buffer, message Message) error {
+	head := p.n
+	if p.Keepalive {
+		head++
+	}
+
 	size := message.RecommendBufferSize()
 	if cap(buffer.Data) < size {
-		buffer.Data = make([]byte, p.n, size)
+		buffer.Data = make([]byte, head, size+1)
 	} else {
-		buffer.Data = buffer.Data[:p.n]
+		buffer.Data = buffer.Data[:head]
+	}
+
+	if p.Keepalive {
+		buffer.Data[p.n] = keepaliveData
 	}
+
 	return message.WriteBuffer(buffer)
 }
 
@@ -105,31 +131,94 @@ func (p *SimpleProtocol) Write(writer io.Writer, buffer *Buffer) error {
 	return nil
 }
 
-// Read a packet. The buffer maybe grows.
+// Read a packet. The buffer maybe grows. When Keepalive is enabled, ping
+// and pong control packets are consumed internally and dispatched to
+// OnPing/OnPong instead of being returned; Read keeps reading until a data
+// packet arrives.
 func (p *SimpleProtocol) Read(reader io.Reader, buffer *Buffer) error {
-	if _, err := io.ReadFull(reader, p.head); err != nil {
-		return err
-	}
+	for {
+		if _, err := io.ReadFull(reader, p.head); err != nil {
+			return err
+		}
 
-	size := p.decodeHead()
+		size := p.decodeHead()
 
-	if p.MaxPacketSize > 0 && size > p.MaxPacketSize {
-		return PacketTooLargeError
-	}
+		if p.MaxPacketSize > 0 && size > p.MaxPacketSize {
+			return PacketTooLargeError
+		}
 
-	if cap(buffer.Data) < size {
-		buffer.Data = make([]byte, size)
-	} else {
-		buffer.Data = buffer.Data[0:size]
-	}
+		if cap(buffer.Data) < size {
+			buffer.Data = getPooled(size)
+		} else {
+			buffer.Data = buffer.Data[0:size]
+		}
 
-	if size == 0 {
-		return nil
+		if !p.Keepalive {
+			if size > 0 {
+				if _, err := io.ReadFull(reader, buffer.Data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// With Keepalive on, a zero-length packet is malformed: every
+		// packet, including pings and pongs, carries at least the
+		// opcode byte.
+		if size == 0 {
+			return KeepaliveFrameError
+		}
+
+		if _, err := io.ReadFull(reader, buffer.Data); err != nil {
+			return err
+		}
+
+		opcode := buffer.Data[0]
+
+		switch opcode {
+		case keepaliveData:
+			// Shift the payload down over the opcode byte in place,
+			// rather than reslicing from index 1, so the buffer's
+			// capacity (and its eligibility for the size-class pool)
+			// is unchanged.
+			copy(buffer.Data, buffer.Data[1:])
+			buffer.Data = buffer.Data[:size-1]
+			return nil
+		case keepalivePing:
+			if p.OnPing != nil {
+				p.OnPing()
+			}
+			buffer.Release()
+		case keepalivePong:
+			if p.OnPong != nil {
+				p.OnPong()
+			}
+			buffer.Release()
+		default:
+			return KeepaliveFrameError
+		}
 	}
+}
 
-	if _, err := io.ReadFull(reader, buffer.Data); err != nil {
-		return err
+// WritePing writes a ping control packet. Keepalive must be true.
+func (p *SimpleProtocol) WritePing(writer io.Writer) error {
+	return p.writeControl(writer, keepalivePing)
+}
+
+// WritePong writes a pong control packet. Keepalive must be true.
+func (p *SimpleProtocol) WritePong(writer io.Writer) error {
+	return p.writeControl(writer, keepalivePong)
+}
+
+func (p *SimpleProtocol) writeControl(writer io.Writer, opcode byte) error {
+	if !p.Keepalive {
+		return KeepaliveNotEnabledError
 	}
 
-	return nil
+	data := make([]byte, p.n+1)
+	data[p.n] = opcode
+	p.encodeHead(data)
+
+	_, err := writer.Write(data)
+	return err
 }